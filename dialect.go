@@ -0,0 +1,168 @@
+// Copyright (C) 2018 Michael J. Fromberger. All Rights Reserved.
+
+package prgfile
+
+import (
+	"sort"
+	"strings"
+)
+
+// A Dialect describes the token table (or tables) used to decode a
+// tokenized BASIC program. Different Commodore machines and BASIC
+// revisions assign different spellings to token bytes, and some extend
+// the single-byte token space with one or more escape-prefixed tables for
+// two-byte tokens.
+//
+// Third parties may construct their own Dialect, e.g. to decode a
+// cartridge that adds its own command set, and pass it to New with
+// WithDialect.
+type Dialect struct {
+	TokenBase byte // the smallest byte value assigned to a primary token
+
+	// Tokens is the primary token table, indexed by code - TokenBase.
+	Tokens []string
+
+	// Extended maps an escape lead byte (e.g. 0xce or 0xfe) to the table of
+	// two-byte token spellings selected by the byte that follows it, for
+	// dialects whose primary token space is not large enough to hold all
+	// of their keywords.
+	Extended map[byte][]string
+
+	// Remark is the primary token code that begins a REM-style comment,
+	// whose body is copied literally through to the end of the line
+	// rather than tokenized. A Dialect that has no such token, or whose
+	// spelling is not REM, should leave this zero.
+	Remark byte
+}
+
+// remarkToken reports the primary token code for ch, and whether it begins
+// a REM-style comment under d.
+func (d *Dialect) remarkToken(ch byte) bool {
+	return d.Remark != 0 && ch == d.Remark
+}
+
+// token reports the spelling of the primary token ch, if any.
+func (d *Dialect) token(ch byte) (string, bool) {
+	v := int(ch) - int(d.TokenBase)
+	if v >= 0 && v < len(d.Tokens) {
+		return d.Tokens[v], true
+	}
+	return "", false
+}
+
+// extSpelling reports the spelling assigned to ch in an extended token
+// table, if any.
+func extSpelling(table []string, ch byte) (string, bool) {
+	v := int(ch)
+	if v >= 0 && v < len(table) && table[v] != "" {
+		return table[v], true
+	}
+	return "", false
+}
+
+// matchToken reports the code for the longest entry of d's primary or
+// extended token tables that is a prefix of s, as the one or two bytes
+// that would encode it, along with the length of spelling matched. Ties
+// are broken by lead byte, ascending, with the primary table (which has
+// no lead byte of its own) taking precedence, so the result is
+// deterministic regardless of Extended's map iteration order.
+func (d *Dialect) matchToken(s string) (code []byte, n int, ok bool) {
+	for i, sp := range d.Tokens {
+		if sp != "" && len(sp) > n && strings.HasPrefix(s, sp) {
+			code, n, ok = []byte{byte(int(d.TokenBase) + i)}, len(sp), true
+		}
+	}
+	leads := make([]byte, 0, len(d.Extended))
+	for lead := range d.Extended {
+		leads = append(leads, lead)
+	}
+	sort.Slice(leads, func(i, j int) bool { return leads[i] < leads[j] })
+	for _, lead := range leads {
+		for i, sp := range d.Extended[lead] {
+			if sp != "" && len(sp) > n && strings.HasPrefix(s, sp) {
+				code, n, ok = []byte{lead, byte(i)}, len(sp), true
+			}
+		}
+	}
+	return
+}
+
+// isRemark reports whether code, as returned by matchToken, is d's Remark
+// token.
+func (d *Dialect) isRemark(code []byte) bool {
+	return d.Remark != 0 && len(code) == 1 && code[0] == d.Remark
+}
+
+// DialectBASIC2 is the token table for Commodore BASIC 2.0, as shipped on
+// the PET, VIC-20, and Commodore 64. This is the default dialect used by
+// New.
+var DialectBASIC2 = &Dialect{
+	TokenBase: tokenBase,
+	Tokens:    spelling,
+	Remark:    tokenBase + 15, // REM
+}
+
+// basic35Tokens is a representative subset of the commands BASIC 3.5 adds
+// to BASIC 2.0, reached via the 0xfe escape prefix. It is not a complete
+// rendering of the BASIC 3.5 command set.
+var basic35Tokens = []string{
+	"DO", "LOOP", "EXIT", "AS", "PUDEF", "GRAPHIC", "PAINT", "CHAR", "BOX",
+	"CIRCLE", "GSHAPE", "SSHAPE", "DRAW", "LOCATE", "COLOR", "SCNCLR",
+	"SCALE", "HELP", "RGR", "RCLR", "RLUM", "JOY", "RDOT", "DEC", "HEX$",
+	"ERR$", "INSTR", "ELSE", "RESUME", "TRAP", "TRON", "TROFF", "SOUND",
+	"VOL", "AUTO", "WHILE", "UNTIL",
+}
+
+// DialectBASIC35 is the token table for Commodore BASIC 3.5, as used on
+// the Commodore 16 and Plus/4. It extends DialectBASIC2 with a second
+// command set introduced by the lead byte 0xfe.
+var DialectBASIC35 = &Dialect{
+	TokenBase: tokenBase,
+	Tokens:    spelling,
+	Remark:    tokenBase + 15, // REM
+	Extended: map[byte][]string{
+		0xfe: basic35Tokens,
+	},
+}
+
+// basic7Tokens extends basic35Tokens with a representative subset of the
+// additional commands BASIC 7.0 adds for the Commodore 128, notably disk
+// and bank-switching support. It is not a complete rendering of the
+// BASIC 7.0 command set.
+var basic7Tokens = append(append([]string{}, basic35Tokens...),
+	"DIRECTORY", "DSAVE", "DLOAD", "HEADER", "SCRATCH", "COLLECT", "COPY",
+	"RENAME", "BACKUP", "DELETE", "RENUMBER", "KEY", "MONITOR", "USING",
+	"BANK", "FILTER", "PLAY", "TEMPO", "MOVSPR", "SPRITE", "SPRCOLOR",
+	"RREG", "ENVELOPE", "SLEEP", "DCLEAR", "DVERIFY", "WIDTH", "SPRDEF",
+	"QUIT", "BOOT",
+)
+
+// DialectBASIC7 is the token table for Commodore BASIC 7.0, as shipped on
+// the Commodore 128. It extends DialectBASIC35 with further disk and
+// hardware commands introduced by the same 0xfe escape prefix.
+var DialectBASIC7 = &Dialect{
+	TokenBase: tokenBase,
+	Tokens:    spelling,
+	Remark:    tokenBase + 15, // REM
+	Extended: map[byte][]string{
+		0xfe: basic7Tokens,
+	},
+}
+
+// simonsTokens is a representative subset of the ~100 commands added by
+// the Simons' BASIC cartridge for the Commodore 64. Unlike BASIC 3.5 and
+// 7.0, Simons' BASIC patches the tokenizer directly and so simply extends
+// the primary token space past GO, rather than using an escape prefix.
+var simonsTokens = append(append([]string{}, spelling...),
+	"HIRES", "PLOT", "LINE", "BLOCK", "FCHR", "FCOL", "FILL", "CIRCLE",
+	"RECT", "ON KEY", "DISAPA", "OFF KEY", "HIRES ON", "HIRES OFF",
+	"DISPLAY", "CGOTO", "PROC", "CALL", "EXEC", "END PROC", "EXIT",
+)
+
+// DialectSimons is the token table for the Simons' BASIC cartridge
+// extension for the Commodore 64.
+var DialectSimons = &Dialect{
+	TokenBase: tokenBase,
+	Tokens:    simonsTokens,
+	Remark:    tokenBase + 15, // REM
+}
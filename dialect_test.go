@@ -0,0 +1,44 @@
+// Copyright (C) 2018 Michael J. Fromberger. All Rights Reserved.
+
+package prgfile
+
+import (
+	"io"
+	"strings"
+	"testing"
+)
+
+func TestReaderDialect(t *testing.T) {
+	// "10 DO : PRINT"NG" : LOOP", tokenized against BASIC 3.5: the 0xfe
+	// escape prefix selects "DO" (index 0) and "LOOP" (index 1) from
+	// basic35Tokens, surrounding an ordinary BASIC 2.0 PRINT token.
+	const input = "\x01\x00\x12\x00\x0a\x00\xfe\x00:\x99\"NG\":\xfe\x01\x00\x00\x00"
+
+	r, err := New(strings.NewReader(input), WithDialect(DialectBASIC35))
+	if err != nil {
+		t.Fatalf("New: %v", err)
+	}
+	line, err := r.Line()
+	if err != nil {
+		t.Fatalf("Line: %v", err)
+	}
+	want := []string{"DO", `PRINT "NG"`, "LOOP"}
+	if got := line.Insn; !equalStrings(got, want) {
+		t.Errorf("Line().Insn = %q, want %q", got, want)
+	}
+	if _, err := r.Line(); err != io.EOF {
+		t.Errorf("Line: got %v, want io.EOF", err)
+	}
+}
+
+func equalStrings(a, b []string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i, s := range a {
+		if s != b[i] {
+			return false
+		}
+	}
+	return true
+}
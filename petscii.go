@@ -0,0 +1,141 @@
+// Copyright (C) 2018 Michael J. Fromberger. All Rights Reserved.
+
+package prgfile
+
+// A Charset selects how Reader decodes the raw bytes inside quoted string
+// literals and REM bodies into the text reported by Line and NextToken.
+type Charset int
+
+const (
+	// CharsetRaw copies each byte of a string literal or REM body through
+	// unchanged, exactly as it appears in the input. This is the default,
+	// and matches the behavior of a Reader constructed without
+	// WithCharset.
+	CharsetRaw Charset = iota
+
+	// CharsetPETSCIIUnshifted decodes bytes as "unshifted" PETSCII, the
+	// mode most Commodore machines power on into: letters are uppercase,
+	// and the graphic and control codes select line-drawing characters and
+	// screen-control actions rather than lowercase letters.
+	CharsetPETSCIIUnshifted
+
+	// CharsetPETSCIIShifted decodes bytes as "shifted" PETSCII, selected by
+	// pressing Commodore+Shift or typing a lowercase letter: the 0x41-0x5A
+	// range yields lowercase letters, and uppercase letters move to
+	// 0xC1-0xDA.
+	CharsetPETSCIIShifted
+)
+
+// petsciiPUABase is the start of the Private Use Area block into which
+// PETSCII control and graphic codes with no standard Unicode equivalent are
+// mapped, one code point per byte value. This is not a claim that any
+// particular code point has been standardized for that purpose; it exists
+// so Decode and Encode can round-trip bytes that have no better home.
+const petsciiPUABase = 0xE000
+
+// DecodeChar returns the rune that cs assigns to the PRG byte b. This is
+// not a complete rendering of every historical PETSCII variant: only the
+// characters shared with ASCII, the case-shifted letters, and the small
+// set of punctuation unique to PETSCII (the pound sign and the cursor
+// arrows) are given their conventional Unicode spellings. Every other byte
+// -- the line-drawing graphics and the cursor, color, and editing control
+// codes -- is assigned a stable, if arbitrary, code point in the Private
+// Use Area so that Decode and Encode remain inverses of one another.
+func DecodeChar(cs Charset, b byte) rune {
+	if cs == CharsetRaw {
+		return rune(b)
+	}
+	shifted := cs == CharsetPETSCIIShifted
+	switch {
+	case b >= 0x20 && b <= 0x40: // space, digits, and punctuation match ASCII
+		return rune(b)
+	case b >= 0x41 && b <= 0x5A:
+		if shifted {
+			return 'a' + rune(b-0x41)
+		}
+		return 'A' + rune(b-0x41)
+	case b == 0x5B:
+		return '['
+	case b == 0x5C:
+		return '£'
+	case b == 0x5D:
+		return ']'
+	case b == 0x5E:
+		return '↑'
+	case b == 0x5F:
+		return '←'
+	case shifted && b >= 0xC1 && b <= 0xDA:
+		return 'A' + rune(b-0xC1)
+	default:
+		return rune(petsciiPUABase + int(b))
+	}
+}
+
+// EncodeChar returns the PRG byte that cs assigns to r, the inverse of
+// DecodeChar, and reports whether r has an assignment under cs.
+func EncodeChar(cs Charset, r rune) (byte, bool) {
+	if cs == CharsetRaw {
+		if r >= 0 && r < 0x100 {
+			return byte(r), true
+		}
+		return 0, false
+	}
+	b, ok := petsciiEncodeTable(cs)[r]
+	return b, ok
+}
+
+var (
+	petsciiUnshiftedEncode = buildPETSCIIEncodeTable(CharsetPETSCIIUnshifted)
+	petsciiShiftedEncode   = buildPETSCIIEncodeTable(CharsetPETSCIIShifted)
+)
+
+// petsciiEncodeTable returns the precomputed rune-to-byte table for cs.
+func petsciiEncodeTable(cs Charset) map[rune]byte {
+	if cs == CharsetPETSCIIShifted {
+		return petsciiShiftedEncode
+	}
+	return petsciiUnshiftedEncode
+}
+
+// buildPETSCIIEncodeTable inverts DecodeChar over the full byte range for
+// cs. DecodeChar is constructed so that its byte ranges never overlap, so
+// the result is a true inverse.
+func buildPETSCIIEncodeTable(cs Charset) map[rune]byte {
+	m := make(map[rune]byte, 256)
+	for b := 0; b < 256; b++ {
+		m[DecodeChar(cs, byte(b))] = byte(b)
+	}
+	return m
+}
+
+// Decode renders raw, a sequence of PRG bytes, as text under cs.
+func Decode(cs Charset, raw []byte) string {
+	if cs == CharsetRaw {
+		return string(raw)
+	}
+	rs := make([]rune, len(raw))
+	for i, b := range raw {
+		rs[i] = DecodeChar(cs, b)
+	}
+	return string(rs)
+}
+
+// Encode renders s as a sequence of PRG bytes under cs, the inverse of
+// Decode. Runes with no assignment under cs are encoded as '?' (0x3F).
+func Encode(cs Charset, s string) []byte {
+	if cs == CharsetRaw {
+		// s holds raw bytes stuffed directly into a string, not valid
+		// UTF-8 text, so it must be converted back byte-for-byte rather
+		// than decoded as runes.
+		return []byte(s)
+	}
+	out := make([]byte, 0, len(s))
+	for _, r := range s {
+		b, ok := EncodeChar(cs, r)
+		if !ok {
+			b = '?'
+		}
+		out = append(out, b)
+	}
+	return out
+}
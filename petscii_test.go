@@ -0,0 +1,85 @@
+// Copyright (C) 2018 Michael J. Fromberger. All Rights Reserved.
+
+package prgfile
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestPETSCIIRoundTrip(t *testing.T) {
+	// A program containing a reverse-video marker (0x12), a cursor-down
+	// control code (0x11), and a case-shifted letter, so the round trip
+	// exercises both the graphic/control PUA mapping and letter shifting.
+	raw := []byte{'"', 0x12, 'H', 'I', 0x11, 0x92, '"'}
+
+	for _, cs := range []Charset{CharsetRaw, CharsetPETSCIIUnshifted, CharsetPETSCIIShifted} {
+		decoded := Decode(cs, raw)
+		got := Encode(cs, decoded)
+		if string(got) != string(raw) {
+			t.Errorf("Charset %v: Encode(Decode(%q)) = %q, want %q", cs, raw, got, raw)
+		}
+	}
+}
+
+func TestDecodeChar(t *testing.T) {
+	tests := []struct {
+		cs   Charset
+		b    byte
+		want rune
+	}{
+		{CharsetRaw, 'A', 'A'},
+		{CharsetRaw, 0x12, 0x12}, // raw: no PETSCII interpretation at all
+
+		{CharsetPETSCIIUnshifted, 'A', 'A'},     // unshifted: letters are uppercase
+		{CharsetPETSCIIUnshifted, 0x5c, '£'},    // pound sign
+		{CharsetPETSCIIUnshifted, 0x5e, '↑'},    // up arrow
+		{CharsetPETSCIIUnshifted, 0x5f, '←'},    // left arrow
+		{CharsetPETSCIIUnshifted, 0x12, 0xE012}, // reverse-on control: no ASCII/Unicode match
+		{CharsetPETSCIIUnshifted, 0xc1, 0xE0c1}, // unused in unshifted mode: falls back to PUA
+
+		{CharsetPETSCIIShifted, 'A', 'a'},     // shifted: 0x41-0x5a is lowercase
+		{CharsetPETSCIIShifted, 0xc1, 'A'},    // shifted: 0xc1-0xda is uppercase
+		{CharsetPETSCIIShifted, 0x91, 0xE091}, // cursor-up control: falls back to PUA
+	}
+	for _, test := range tests {
+		if got := DecodeChar(test.cs, test.b); got != test.want {
+			t.Errorf("DecodeChar(%v, %#02x) = %q, want %q", test.cs, test.b, got, test.want)
+		}
+	}
+}
+
+func TestReaderCharsetREM(t *testing.T) {
+	// A REM body containing a byte (0x80, END) that would be misread as a
+	// keyword token if the reader kept tokenizing after REM, plus a
+	// reverse-video control byte (0x12).
+	const input = "\x01\x00\x06\x00\x0a\x00\x8f\x80\x12\x00\x00\x00"
+
+	for _, test := range []struct {
+		cs   Charset
+		want string
+	}{
+		{CharsetRaw, "\x80\x12"},
+		{CharsetPETSCIIUnshifted, string([]rune{0xE080, 0xE012})},
+	} {
+		r, err := New(strings.NewReader(input), WithCharset(test.cs))
+		if err != nil {
+			t.Fatalf("New: %v", err)
+		}
+		want := []Token{
+			{TokenNumber, "1", 2},
+			{TokenNumber, "10", 4},
+			{TokenKeyword, "REM", 6},
+			{TokenRemark, test.want, 7},
+			{TokenEOL, "", 9},
+		}
+		for i, w := range want {
+			got, err := r.NextToken()
+			if err != nil {
+				t.Fatalf("Charset %v: NextToken #%d: unexpected error: %v", test.cs, i, err)
+			} else if got != w {
+				t.Errorf("Charset %v: NextToken #%d: got %+v, want %+v", test.cs, i, got, w)
+			}
+		}
+	}
+}
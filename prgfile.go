@@ -56,22 +56,38 @@ var spelling = []string{
 	"ASC", "CHR$", "LEFT$", "RIGHT$", "MID$", "GO",
 }
 
-func isToken(ch byte) (string, bool) {
-	v := int(ch) - tokenBase
-	if v >= 0 && v < len(spelling) {
-		return spelling[v], true
-	}
-	return "", false
-}
-
 // A Reader parses a tokenized program and returns lines containing the decoded
 // instructions.
 type Reader struct {
 	org      uint16 // origin address from the stream header
 	nextAddr uint16 // base address of next line (0 at start)
+	dialect  *Dialect
 
 	buf *bufio.Reader
 	pos int
+
+	state            tokState // what NextToken expects to read next
+	curAddr, curLnum uint16   // address and line number of the line in progress
+
+	onError func(offset int, err error) // see WithErrorHandler
+	recover bool                        // see WithRecover
+	charset Charset                     // see WithCharset
+}
+
+// An Option configures optional behavior of a Reader constructed by New.
+type Option func(*Reader)
+
+// WithDialect sets the token dialect used to decode the input. If this
+// option is not given, the default is DialectBASIC2.
+func WithDialect(d *Dialect) Option {
+	return func(r *Reader) { r.dialect = d }
+}
+
+// WithCharset sets the charset used to decode the bytes of quoted string
+// literals and REM bodies. If this option is not given, the default is
+// CharsetRaw, which reports those bytes unchanged.
+func WithCharset(cs Charset) Option {
+	return func(r *Reader) { r.charset = cs }
 }
 
 // word returns the value of the next 2 bytes of input as a little-endian
@@ -102,8 +118,11 @@ func (r *Reader) fail(msg string, args ...interface{}) error {
 
 // New constructs a *Reader that consumes input from r, which is expected to be
 // positioned at the origin mark beginning a PRG file.
-func New(r io.Reader) (*Reader, error) {
-	rd := &Reader{buf: bufio.NewReader(r)}
+func New(r io.Reader, opts ...Option) (*Reader, error) {
+	rd := &Reader{buf: bufio.NewReader(r), dialect: DialectBASIC2}
+	for _, opt := range opts {
+		opt(rd)
+	}
 	org, err := rd.word()
 	if err != nil {
 		return nil, rd.fail("reading origin: %v", err)
@@ -157,44 +176,26 @@ func (r *Reader) Origin() uint16 { return r.org }
 // Pos returns the current byte offset in the input.
 func (r *Reader) Pos() int { return r.pos }
 
-// Line parses and returns the next line from the input.
+// Line parses and returns the next line from the input. It is implemented
+// in terms of NextToken.
 // It returns nil, io.EOF when the end of instruction marker is reached.
 func (r *Reader) Line() (*Line, error) {
-	addr := r.nextAddr
-
-	// Read the next line address from the line prefix.
-	next, err := r.word()
-	if err != nil {
-		return nil, r.fail("reading next address: %v", err)
-	}
-	r.nextAddr = next
-	if next == 0 {
-		return nil, io.EOF
+	if _, err := r.NextToken(); err != nil { // synthetic address token
+		return nil, err
 	}
+	addr := r.curAddr
 
-	// Read the current line number.
-	lnum, err := r.word()
-	if err != nil {
-		return nil, r.fail("reading line number: %v", err)
+	if _, err := r.NextToken(); err != nil { // synthetic line-number token
+		return nil, err
 	}
+	lnum := r.curLnum
 
 	// Collect instructions.
-	var insns []string      // instructions on current line
-	var words insn          // words in current instruction
-	var cur strings.Builder // current word
-	quoted := false         // currently inside quotes
-
-	// Push the current word onto the instruction.
-	push := func() {
-		if cur.Len() != 0 {
-			words = append(words, cur.String())
-			cur.Reset()
-		}
-	}
+	var insns []string // instructions on current line
+	var words insn     // words in current instruction
 
 	// Push the current instruction onto the line.
 	emit := func() {
-		push()
 		if len(words) != 0 {
 			insns = append(insns, words.String())
 			words = nil
@@ -202,39 +203,18 @@ func (r *Reader) Line() (*Line, error) {
 	}
 
 	for {
-		ch, err := r.byte()
+		tok, err := r.NextToken()
 		if err != nil {
-			return nil, r.fail("reading instruction: %v", err)
-		} else if ch == 0 {
-			emit()
-			break // end of line
+			return nil, err
 		}
-
-		// An unquoted token is expanded to its spelling. This delimits any
-		// previous in-progress word.
-		if s, ok := isToken(ch); ok && !quoted {
-			push()
-			words = append(words, s)
-			continue
-		}
-
-		// Double quotes toggle string literals, inside which tokens are not
-		// expanded (though in principle they should not occur there anyway).
-		if ch == '"' {
-			quoted = !quoted
-		} else if ch == ':' && !quoted {
-			// An un-quoted colon is treated as its own token, even though it does
-			// not appear in the token grammar. This allows instructions to be
-			// distinguished later.
+		switch tok.Kind {
+		case TokenEOL:
 			emit()
-			continue
+			return &Line{N: lnum, Addr: addr, Insn: insns}, nil
+		case TokenColon:
+			emit()
+		default:
+			words = append(words, tok.Text)
 		}
-		cur.WriteByte(ch)
 	}
-
-	return &Line{
-		N:    lnum,
-		Addr: addr,
-		Insn: insns,
-	}, nil
 }
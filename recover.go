@@ -0,0 +1,84 @@
+// Copyright (C) 2018 Michael J. Fromberger. All Rights Reserved.
+
+package prgfile
+
+import "io"
+
+// WithErrorHandler sets a callback invoked, when WithRecover is enabled,
+// each time a malformed line is detected and recovery is attempted. The
+// offset is the byte position at which the error was detected.
+func WithErrorHandler(f func(offset int, err error)) Option {
+	return func(r *Reader) { r.onError = f }
+}
+
+// WithRecover enables best-effort recovery from malformed lines, such as a
+// missing end-of-line marker, a truncated or implausible next-line
+// address, or a string literal left unterminated by its line. Rather than
+// failing outright, the malformed line is reported via the handler set by
+// WithErrorHandler (if any), and the Reader resynchronizes at the next
+// line boundary that looks plausible.
+//
+// Recovery is inherently heuristic: the Addr reported for a line read
+// after a resynchronization may be stale, since the corrupted data that
+// would have supplied it is, by definition, lost. Recovery itself can
+// fail, if no plausible boundary remains before the input is exhausted,
+// in which case the original error is returned.
+//
+// If this option is not given, the default is false: any malformed line
+// fails the read.
+func WithRecover(recover bool) Option {
+	return func(r *Reader) { r.recover = recover }
+}
+
+// recoverFrom reports err via the configured error handler and, if
+// recovery is enabled, attempts to resynchronize at the next plausible
+// line boundary and resume tokenizing from there. If recovery is disabled
+// or resynchronization fails, err is returned unchanged.
+func (r *Reader) recoverFrom(offset int, err error) (Token, error) {
+	if !r.recover {
+		return Token{}, err
+	}
+	if r.onError != nil {
+		r.onError(offset, err)
+	}
+	if rerr := r.resync(); rerr != nil {
+		return Token{}, err
+	}
+	return r.NextToken()
+}
+
+// resync scans forward from the current position for a plausible line
+// boundary: an end-of-line marker (0x00) followed by a WORD that is
+// either zero (end of program) or no smaller than the last known
+// next-line address, consuming bytes up to but not including that WORD
+// so normal parsing can resume from it.
+func (r *Reader) resync() error {
+	for {
+		peek, _ := r.buf.Peek(3) // short reads are expected near end of input
+		if len(peek) == 0 {
+			return r.fail("resynchronizing: %v", io.EOF)
+		}
+		if peek[0] == 0 {
+			if len(peek) == 3 {
+				next := uint16(peek[1]) | uint16(peek[2])<<8
+				if next == 0 || next >= r.nextAddr {
+					if _, err := r.byte(); err != nil { // consume the marker only
+						return r.fail("resynchronizing: %v", err)
+					}
+					r.state = stateAddr
+					return nil
+				}
+			} else if len(peek) == 2 && peek[1] == 0 {
+				// Exactly the end-of-program marker, with nothing following.
+				if _, err := r.byte(); err != nil {
+					return r.fail("resynchronizing: %v", err)
+				}
+				r.state = stateAddr
+				return nil
+			}
+		}
+		if _, err := r.byte(); err != nil {
+			return r.fail("resynchronizing: %v", err)
+		}
+	}
+}
@@ -0,0 +1,238 @@
+// Copyright (C) 2018 Michael J. Fromberger. All Rights Reserved.
+
+package prgfile
+
+import (
+	"io"
+	"strings"
+	"testing"
+)
+
+func TestRecoverResync(t *testing.T) {
+	// org=0x0801; line 2069 "100 PRINT "HI""; then a corrupted next-line
+	// address (0x0800, which moves backward from 0x0815) followed by a
+	// stray garbage byte before the next plausible line boundary, which
+	// starts a line at 0x0820 with lnum 200 and a single END instruction.
+	const input = "\x01\x08" + // org
+		"\x15\x08\x64\x00\x99 \"HI\"\x00" + // line 2069: 100 PRINT "HI"
+		"\x00\x08\xab" + // corrupted address, plus garbage
+		"\x00\x20\x08\xc8\x00\x80\x00" + // resynchronized line 2080: 200 END
+		"\x00\x00" // end of program
+
+	var errs []string
+	r, err := New(strings.NewReader(input), WithRecover(true), WithErrorHandler(func(offset int, err error) {
+		errs = append(errs, err.Error())
+	}))
+	if err != nil {
+		t.Fatalf("New: %v", err)
+	}
+
+	want := []Token{
+		{TokenNumber, "2049", 2}, // line address 0x0801, same as org
+		{TokenNumber, "100", 4},
+		{TokenKeyword, "PRINT", 6},
+		{TokenOperator, " ", 7},
+		{TokenString, `"HI"`, 8},
+		{TokenEOL, "", 12},
+		{TokenNumber, "2069", 17}, // stale: the corrupted line's own address was lost
+		{TokenNumber, "200", 19},
+		{TokenKeyword, "END", 21},
+		{TokenEOL, "", 22},
+	}
+	for i, w := range want {
+		got, err := r.NextToken()
+		if err != nil {
+			t.Fatalf("NextToken #%d: unexpected error: %v", i, err)
+		} else if got != w {
+			t.Errorf("NextToken #%d: got %+v, want %+v", i, got, w)
+		}
+	}
+	if _, err := r.NextToken(); err != io.EOF {
+		t.Errorf("NextToken: got %v, want io.EOF", err)
+	}
+	if len(errs) != 1 {
+		t.Fatalf("onError calls: got %d, want 1 (errs=%v)", len(errs), errs)
+	}
+	if !strings.Contains(errs[0], "implausible next address") {
+		t.Errorf("onError message = %q, want mention of implausible address", errs[0])
+	}
+}
+
+func TestRecoverGivesUpAtEOF(t *testing.T) {
+	// The corrupted address is the last thing in the input, so there is no
+	// plausible boundary left to resynchronize at; the original error
+	// should be reported, not a resynchronization failure.
+	const input = "\x01\x08\x15\x08\x64\x00\x80\x00\x00\x08"
+
+	r, err := New(strings.NewReader(input), WithRecover(true))
+	if err != nil {
+		t.Fatalf("New: %v", err)
+	}
+	for {
+		_, err := r.NextToken()
+		if err == nil {
+			continue
+		}
+		if err == io.EOF {
+			t.Fatal("NextToken: reached EOF without the expected error")
+		}
+		if !strings.Contains(err.Error(), "implausible next address") {
+			t.Errorf("NextToken error = %v, want implausible next address", err)
+		}
+		break
+	}
+}
+
+func TestRecoverMissingTerminator(t *testing.T) {
+	// line 2080 "200 END" is never followed by an end-of-line marker: the
+	// input simply ends mid-line. There is no plausible boundary left to
+	// resynchronize at, so resync gives up and the original read error,
+	// not a resynchronization failure, is what's reported.
+	const input = "\x01\x08\x15\x08\x64\x00\x80\x00" + // line 2069: 100 END
+		"\x20\x08\xc8\x00\x80" // line 2080: 200 END, missing end-of-line marker
+
+	r, err := New(strings.NewReader(input), WithRecover(true))
+	if err != nil {
+		t.Fatalf("New: %v", err)
+	}
+	for {
+		_, err := r.NextToken()
+		if err == nil {
+			continue
+		}
+		if err == io.EOF {
+			t.Fatal("NextToken: reached EOF without the expected error")
+		}
+		if !strings.Contains(err.Error(), "reading instruction") {
+			t.Errorf("NextToken error = %v, want mention of reading instruction", err)
+		}
+		break
+	}
+}
+
+func TestRecoverTruncatedAddress(t *testing.T) {
+	// The next-line address WORD following a valid line is cut off after
+	// only one of its two bytes, so reading it fails outright rather than
+	// yielding an implausible value; there is nothing left to resynchronize
+	// at, so the truncation error itself is reported.
+	const input = "\x01\x08\x15\x08\x64\x00\x80\x00" + // line 2069: 100 END
+		"\x00" // truncated next-line address: only 1 of 2 bytes present
+
+	r, err := New(strings.NewReader(input), WithRecover(true))
+	if err != nil {
+		t.Fatalf("New: %v", err)
+	}
+	for {
+		_, err := r.NextToken()
+		if err == nil {
+			continue
+		}
+		if err == io.EOF {
+			t.Fatal("NextToken: reached EOF without the expected error")
+		}
+		if !strings.Contains(err.Error(), "reading next address") {
+			t.Errorf("NextToken error = %v, want mention of reading next address", err)
+		}
+		break
+	}
+}
+
+func TestRecoverInQuoteEOF(t *testing.T) {
+	// The string literal opened by PRINT's argument is never closed, and
+	// the input ends before either a closing quote or an end-of-line
+	// marker appears. As above, there is no boundary left to resynchronize
+	// at, so the original "reading string literal" error is reported.
+	const input = "\x01\x08\x15\x08\x64\x00\x99 \"HI" // 100 PRINT "HI, unterminated
+
+	r, err := New(strings.NewReader(input), WithRecover(true))
+	if err != nil {
+		t.Fatalf("New: %v", err)
+	}
+	for {
+		_, err := r.NextToken()
+		if err == nil {
+			continue
+		}
+		if err == io.EOF {
+			t.Fatal("NextToken: reached EOF without the expected error")
+		}
+		if !strings.Contains(err.Error(), "reading string literal") {
+			t.Errorf("NextToken error = %v, want mention of reading string literal", err)
+		}
+		break
+	}
+}
+
+func TestRecoverThreeOfFourLines(t *testing.T) {
+	// Four lines, one of which (2069's real continuation) is corrupted by
+	// a backward next-line address plus a stray garbage byte, as in
+	// TestRecoverResync; the line before the corruption, the resynchronized
+	// line immediately after it, and a further line after that should all
+	// still be read normally.
+	const input = "\x01\x08" + // org
+		"\x15\x08\x64\x00\x99 \"HI\"\x00" + // line 2049: 100 PRINT "HI"
+		"\x00\x08\xab" + // corrupted address, plus garbage
+		"\x00\x20\x08\xc8\x00\x80\x00" + // resynchronized line 2080: 200 END
+		"\x2b\x08\x2c\x01\x80\x00" + // line 2091: 300 END
+		"\x00\x00" // end of program
+
+	var errs []string
+	r, err := New(strings.NewReader(input), WithRecover(true), WithErrorHandler(func(offset int, err error) {
+		errs = append(errs, err.Error())
+	}))
+	if err != nil {
+		t.Fatalf("New: %v", err)
+	}
+
+	want := []Token{
+		{TokenNumber, "2049", 2},
+		{TokenNumber, "100", 4},
+		{TokenKeyword, "PRINT", 6},
+		{TokenOperator, " ", 7},
+		{TokenString, `"HI"`, 8},
+		{TokenEOL, "", 12},
+		{TokenNumber, "2069", 17}, // stale: the corrupted line's own address was lost
+		{TokenNumber, "200", 19},
+		{TokenKeyword, "END", 21},
+		{TokenEOL, "", 22},
+		{TokenNumber, "2080", 23},
+		{TokenNumber, "300", 25},
+		{TokenKeyword, "END", 27},
+		{TokenEOL, "", 28},
+	}
+	for i, w := range want {
+		got, err := r.NextToken()
+		if err != nil {
+			t.Fatalf("NextToken #%d: unexpected error: %v", i, err)
+		} else if got != w {
+			t.Errorf("NextToken #%d: got %+v, want %+v", i, got, w)
+		}
+	}
+	if _, err := r.NextToken(); err != io.EOF {
+		t.Errorf("NextToken: got %v, want io.EOF", err)
+	}
+	if len(errs) != 1 {
+		t.Fatalf("onError calls: got %d, want 1 (errs=%v)", len(errs), errs)
+	}
+}
+
+func TestNoRecoverFailsImmediately(t *testing.T) {
+	// Without WithRecover, a backward next-line address is not even treated
+	// as an error: line 2080's "address" of 2048 is accepted as-is.
+	const input = "\x01\x08\x15\x08\x64\x00\x80\x00" + // line 2049: 100 END
+		"\x00\x08\x00\x00\x80\x00" + // line 2069: 0 END (address moves backward)
+		"\x00\x00" // end of program
+
+	r, err := New(strings.NewReader(input))
+	if err != nil {
+		t.Fatalf("New: %v", err)
+	}
+	for i := 0; i < 8; i++ { // 2 lines, each address+lnum+END+EOL
+		if _, err := r.NextToken(); err != nil {
+			t.Fatalf("NextToken #%d: unexpected error: %v", i, err)
+		}
+	}
+	if _, err := r.NextToken(); err != io.EOF {
+		t.Errorf("NextToken: got %v, want io.EOF (backward address should be accepted without recovery)", err)
+	}
+}
@@ -0,0 +1,254 @@
+// Copyright (C) 2018 Michael J. Fromberger. All Rights Reserved.
+
+package prgfile
+
+import (
+	"io"
+	"strconv"
+	"strings"
+)
+
+// A TokenKind identifies the lexical category of a Token.
+type TokenKind int
+
+const (
+	// TokenKeyword is a decoded BASIC keyword or operator, expanded from a
+	// single- or two-byte token in the input.
+	TokenKeyword TokenKind = iota
+
+	// TokenNumber is an unquoted run of digits, including the synthetic
+	// line-address and line-number fields that precede each line's
+	// instructions.
+	TokenNumber
+
+	// TokenString is a quoted string literal, including its quotes.
+	TokenString
+
+	// TokenIdent is an unquoted run of letters and digits that is not
+	// entirely numeric, such as a variable name.
+	TokenIdent
+
+	// TokenOperator is a single byte of unquoted punctuation, including
+	// whitespace, that the dialect does not assign to a keyword token: for
+	// example the parentheses and comma in "A(1,2)" are each their own
+	// TokenOperator, not grouped with the digits around them.
+	TokenOperator
+
+	// TokenColon is an unquoted ':' separating instructions on a line.
+	TokenColon
+
+	// TokenEOL marks the end of a line's instructions.
+	TokenEOL
+
+	// TokenRemark is the text following a REM token, copied verbatim
+	// (rather than tokenized) through to the end of the line.
+	TokenRemark
+)
+
+// A Token is a single lexical unit decoded from a Reader's input, tagged
+// with its PRG byte offset so callers can point back into the binary.
+type Token struct {
+	Kind   TokenKind
+	Text   string
+	Offset int // byte offset of the first byte of the token
+}
+
+// tokState identifies what NextToken expects to read next.
+type tokState int
+
+const (
+	stateAddr   tokState = iota // expecting the next-line address WORD
+	stateLnum                   // expecting the line-number WORD
+	stateBody                   // expecting instruction bytes
+	stateRemark                 // expecting the raw text of a REM body
+)
+
+// NextToken returns the next token from the input, streaming across line
+// boundaries. It returns io.EOF, via the same rule as Line, when the
+// end-of-program marker is reached.
+func (r *Reader) NextToken() (Token, error) {
+	switch r.state {
+	case stateAddr:
+		return r.nextAddrToken()
+	case stateLnum:
+		return r.nextLnumToken()
+	case stateRemark:
+		return r.nextRemarkToken()
+	default:
+		return r.nextBodyToken()
+	}
+}
+
+func (r *Reader) nextAddrToken() (Token, error) {
+	offset := r.pos
+	addr := r.nextAddr
+	next, err := r.word()
+	if err != nil {
+		return r.recoverFrom(offset, r.fail("reading next address: %v", err))
+	}
+	if r.recover && next != 0 && next < addr {
+		// An address that moves backward is not plausible for a
+		// well-formed file; treat it as corruption and resynchronize.
+		return r.recoverFrom(offset, r.fail("implausible next address %#04x < %#04x", next, addr))
+	}
+	r.nextAddr = next
+	if next == 0 {
+		return Token{}, io.EOF
+	}
+	r.curAddr = addr
+	r.state = stateLnum
+	return Token{Kind: TokenNumber, Text: strconv.Itoa(int(addr)), Offset: offset}, nil
+}
+
+func (r *Reader) nextLnumToken() (Token, error) {
+	offset := r.pos
+	lnum, err := r.word()
+	if err != nil {
+		return r.recoverFrom(offset, r.fail("reading line number: %v", err))
+	}
+	r.curLnum = lnum
+	r.state = stateBody
+	return Token{Kind: TokenNumber, Text: strconv.Itoa(int(lnum)), Offset: offset}, nil
+}
+
+func (r *Reader) nextBodyToken() (Token, error) {
+	offset := r.pos
+	ch, err := r.byte()
+	if err != nil {
+		return r.recoverFrom(offset, r.fail("reading instruction: %v", err))
+	}
+
+	if ch == 0 {
+		r.state = stateAddr
+		return Token{Kind: TokenEOL, Offset: offset}, nil
+	}
+
+	// A token is expanded to its spelling. A dialect's Remark token (REM in
+	// every dialect this package ships) consumes the rest of the line as
+	// literal text, so the bytes that follow must not be treated as
+	// potential tokens (a byte >= 128 inside a comment would otherwise be
+	// misread as a keyword).
+	if s, ok := r.dialect.token(ch); ok {
+		if r.dialect.remarkToken(ch) {
+			r.state = stateRemark
+		}
+		return Token{Kind: TokenKeyword, Text: s, Offset: offset}, nil
+	}
+
+	// An escape prefix introduces a two-byte token from one of the
+	// dialect's extended tables; consume the following byte and look up its
+	// spelling there.
+	if table, ok := r.dialect.Extended[ch]; ok {
+		ext, err := r.byte()
+		if err != nil {
+			return r.recoverFrom(offset, r.fail("reading extended token: %v", err))
+		}
+		s, ok := extSpelling(table, ext)
+		if !ok {
+			return Token{}, r.fail("unknown extended token %#02x %#02x", ch, ext)
+		}
+		return Token{Kind: TokenKeyword, Text: s, Offset: offset}, nil
+	}
+
+	if ch == '"' {
+		return r.readString(offset)
+	}
+	if ch == ':' {
+		return Token{Kind: TokenColon, Offset: offset}, nil
+	}
+	return r.readRun(ch, offset)
+}
+
+// readString reads a quoted string literal, including its quotes, starting
+// from the opening quote already consumed at offset. An end-of-line marker
+// found before the closing quote is left unread, so the string is reported
+// as-is and the marker surfaces as the next token. The bytes are decoded
+// per r.charset (see WithCharset).
+func (r *Reader) readString(offset int) (Token, error) {
+	raw := []byte{'"'}
+	for {
+		ch, err := r.byte()
+		if err != nil {
+			return r.recoverFrom(offset, r.fail("reading string literal: %v", err))
+		}
+		if ch == 0 {
+			r.buf.UnreadByte()
+			r.pos--
+			break
+		}
+		raw = append(raw, ch)
+		if ch == '"' {
+			break
+		}
+	}
+	return Token{Kind: TokenString, Text: Decode(r.charset, raw), Offset: offset}, nil
+}
+
+// nextRemarkToken reads the literal, untokenized text of a REM body up to
+// but not including the line's end-of-line marker, decoded per r.charset
+// (see WithCharset).
+func (r *Reader) nextRemarkToken() (Token, error) {
+	offset := r.pos
+	var raw []byte
+	for {
+		peek, err := r.buf.Peek(1)
+		if err != nil {
+			return r.recoverFrom(offset, r.fail("reading remark: %v", err))
+		}
+		if peek[0] == 0 {
+			break
+		}
+		ch, err := r.byte()
+		if err != nil {
+			return r.recoverFrom(offset, r.fail("reading remark: %v", err))
+		}
+		raw = append(raw, ch)
+	}
+	r.state = stateBody
+	return Token{Kind: TokenRemark, Text: Decode(r.charset, raw), Offset: offset}, nil
+}
+
+// isAlnum reports whether b is an ASCII letter or digit.
+func isAlnum(b byte) bool {
+	return (b >= '0' && b <= '9') || (b >= 'A' && b <= 'Z') || (b >= 'a' && b <= 'z')
+}
+
+// readRun reads a maximal run of unquoted letters and digits starting with
+// ch, classifying it as a number if it consists entirely of digits and as
+// an identifier otherwise. A ch that is not itself a letter or digit is
+// reported as its own single-byte TokenOperator, since punctuation bytes
+// are not coalesced together.
+func (r *Reader) readRun(ch byte, offset int) (Token, error) {
+	if !isAlnum(ch) {
+		return Token{Kind: TokenOperator, Text: string(ch), Offset: offset}, nil
+	}
+	var sb strings.Builder
+	sb.WriteByte(ch)
+	allDigits := ch >= '0' && ch <= '9'
+	for {
+		peek, err := r.buf.Peek(1)
+		if err != nil {
+			break
+		}
+		b := peek[0]
+		if !isAlnum(b) {
+			break
+		}
+		if _, ok := r.dialect.token(b); ok {
+			break
+		}
+		if _, ok := r.dialect.Extended[b]; ok {
+			break
+		}
+		if _, err := r.byte(); err != nil {
+			return Token{}, r.fail("reading instruction: %v", err)
+		}
+		sb.WriteByte(b)
+		allDigits = allDigits && b >= '0' && b <= '9'
+	}
+	kind := TokenIdent
+	if allDigits {
+		kind = TokenNumber
+	}
+	return Token{Kind: kind, Text: sb.String(), Offset: offset}, nil
+}
@@ -0,0 +1,78 @@
+// Copyright (C) 2018 Michael J. Fromberger. All Rights Reserved.
+
+package prgfile
+
+import (
+	"io"
+	"strings"
+	"testing"
+)
+
+func TestNextToken(t *testing.T) {
+	// @0801 / 0801 100 PRINT "HELLO WORLD" / 0815 110 GOTO 100
+	const input = "\x01\x08\x15\x08\x64\x00\x99 \"HELLO WORLD\"\x00\x1c\x08\x6e\x00\x89100\x00\x00\x00"
+
+	r, err := New(strings.NewReader(input))
+	if err != nil {
+		t.Fatalf("New: %v", err)
+	}
+
+	want := []Token{
+		{TokenNumber, "2049", 2}, // line address 0x0801
+		{TokenNumber, "100", 4},  // line number
+		{TokenKeyword, "PRINT", 6},
+		{TokenOperator, " ", 7},
+		{TokenString, `"HELLO WORLD"`, 8},
+		{TokenEOL, "", 21},
+		{TokenNumber, "2069", 22}, // line address 0x0815
+		{TokenNumber, "110", 24},
+		{TokenKeyword, "GOTO", 26},
+		{TokenNumber, "100", 27},
+		{TokenEOL, "", 30},
+	}
+	for i, w := range want {
+		got, err := r.NextToken()
+		if err != nil {
+			t.Fatalf("NextToken #%d: unexpected error: %v", i, err)
+		} else if got != w {
+			t.Errorf("NextToken #%d: got %+v, want %+v", i, got, w)
+		}
+	}
+	if _, err := r.NextToken(); err != io.EOF {
+		t.Errorf("NextToken: got %v, want io.EOF", err)
+	}
+}
+
+func TestNextTokenPunctuation(t *testing.T) {
+	// @0801 / 0801 100 A(1,2): parentheses and the comma must each be their
+	// own TokenOperator, not lumped in with the digits around them.
+	const input = "\x01\x08\x15\x08\x64\x00A(1,2)\x00\x00\x00"
+
+	r, err := New(strings.NewReader(input))
+	if err != nil {
+		t.Fatalf("New: %v", err)
+	}
+
+	want := []Token{
+		{TokenNumber, "2049", 2}, // line address 0x0801
+		{TokenNumber, "100", 4},  // line number
+		{TokenIdent, "A", 6},
+		{TokenOperator, "(", 7},
+		{TokenNumber, "1", 8},
+		{TokenOperator, ",", 9},
+		{TokenNumber, "2", 10},
+		{TokenOperator, ")", 11},
+		{TokenEOL, "", 12},
+	}
+	for i, w := range want {
+		got, err := r.NextToken()
+		if err != nil {
+			t.Fatalf("NextToken #%d: unexpected error: %v", i, err)
+		} else if got != w {
+			t.Errorf("NextToken #%d: got %+v, want %+v", i, got, w)
+		}
+	}
+	if _, err := r.NextToken(); err != io.EOF {
+		t.Errorf("NextToken: got %v, want io.EOF", err)
+	}
+}
@@ -0,0 +1,150 @@
+// Copyright (C) 2018 Michael J. Fromberger. All Rights Reserved.
+
+package prgfile
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"strings"
+)
+
+// A Writer encodes program lines into a tokenized PRG byte stream, the
+// inverse of Reader.
+type Writer struct {
+	w       *bufio.Writer
+	addr    uint16   // address of the next line to be written
+	dialect *Dialect // see WithWriterDialect
+	charset Charset  // see WithWriterCharset
+}
+
+// A WriterOption configures optional behavior of a Writer constructed by
+// NewWriter.
+type WriterOption func(*Writer)
+
+// WithWriterDialect sets the token dialect used to encode instructions,
+// the inverse of the Reader option WithDialect. It must match the dialect
+// used to decode the Lines being written, or keywords specific to that
+// dialect will not re-encode to their original token bytes. If this
+// option is not given, the default is DialectBASIC2.
+func WithWriterDialect(d *Dialect) WriterOption {
+	return func(wr *Writer) { wr.dialect = d }
+}
+
+// WithWriterCharset sets the charset used to encode the text of quoted
+// string literals and REM bodies, the inverse of the Reader option
+// WithCharset. It must match the charset used to decode the Lines being
+// written: a Line.Insn decoded under a non-raw charset may contain
+// multi-byte runes (see Decode), and encoding those with the wrong
+// charset, or not at all, corrupts the output. If this option is not
+// given, the default is CharsetRaw.
+func WithWriterCharset(cs Charset) WriterOption {
+	return func(wr *Writer) { wr.charset = cs }
+}
+
+// NewWriter constructs a *Writer that writes a tokenized program to w,
+// beginning with the given origin address.
+func NewWriter(w io.Writer, origin uint16, opts ...WriterOption) (*Writer, error) {
+	wr := &Writer{w: bufio.NewWriter(w), addr: origin, dialect: DialectBASIC2}
+	for _, opt := range opts {
+		opt(wr)
+	}
+	if err := writeWord(wr.w, origin); err != nil {
+		return nil, fmt.Errorf("writing origin: %v", err)
+	}
+	return wr, nil
+}
+
+// writeWord writes v to w as a little-endian WORD.
+func writeWord(w *bufio.Writer, v uint16) error {
+	if err := w.WriteByte(byte(v)); err != nil {
+		return err
+	}
+	return w.WriteByte(byte(v >> 8))
+}
+
+// Put encodes line and appends it to the output stream. Lines must be
+// written in the order they are to appear in the program; the address of
+// each line is computed from the origin and the encoded length of the
+// lines written before it, so the Addr field of line is ignored.
+func (wr *Writer) Put(line *Line) error {
+	var content []byte
+	for i, in := range line.Insn {
+		if i > 0 {
+			content = append(content, ':')
+		}
+		content = append(content, wr.encodeInsn(in)...)
+	}
+
+	next := wr.addr + uint16(5+len(content)) // next(2) + lnum(2) + content + eol(1)
+	if err := writeWord(wr.w, next); err != nil {
+		return fmt.Errorf("writing next address: %v", err)
+	}
+	if err := writeWord(wr.w, line.N); err != nil {
+		return fmt.Errorf("writing line number: %v", err)
+	}
+	if _, err := wr.w.Write(content); err != nil {
+		return fmt.Errorf("writing instructions: %v", err)
+	}
+	if err := wr.w.WriteByte(0); err != nil {
+		return fmt.Errorf("writing end-of-line marker: %v", err)
+	}
+	wr.addr = next
+	return nil
+}
+
+// Close writes the end-of-program marker and flushes any buffered output.
+// The caller is still responsible for closing the underlying writer, if
+// necessary.
+func (wr *Writer) Close() error {
+	if err := writeWord(wr.w, 0); err != nil {
+		return fmt.Errorf("writing end-of-program marker: %v", err)
+	}
+	return wr.w.Flush()
+}
+
+// encodeInsn tokenizes a single decoded instruction back into its PRG byte
+// representation, by greedy longest-match against wr.dialect outside of
+// quoted strings. The text of a quoted string, and the text following a
+// Remark token (see Dialect.Remark), are encoded per wr.charset rather
+// than matched against the dialect: once the dialect's Remark token is
+// matched, the rest of s is consumed as a literal comment body, matching
+// how Reader stops tokenizing after REM. Each is encoded in a single call
+// to Encode rather than byte-by-byte, since Decode may have rendered a
+// single PRG byte as a multi-byte rune (see Charset).
+// The final entry of spelling, "GO", exists precisely so that "GO TO"
+// (with an intervening space, as opposed to the single token "GOTO")
+// re-tokenizes to the same bytes a real tokenizer would produce.
+func (wr *Writer) encodeInsn(s string) []byte {
+	var out []byte
+	for i := 0; i < len(s); {
+		ch := s[i]
+		if ch == '"' {
+			out = append(out, ch)
+			i++
+			j := i + strings.IndexByte(s[i:], '"')
+			if j < i { // no closing quote
+				j = len(s)
+			}
+			out = append(out, Encode(wr.charset, s[i:j])...)
+			i = j
+			if i < len(s) {
+				out = append(out, '"')
+				i++
+			}
+			continue
+		}
+		if code, n, ok := wr.dialect.matchToken(s[i:]); ok {
+			out = append(out, code...)
+			i += n
+			if wr.dialect.isRemark(code) {
+				out = append(out, Encode(wr.charset, s[i:])...)
+				return out
+			}
+			continue
+		}
+		out = append(out, ch)
+		i++
+	}
+	return out
+}
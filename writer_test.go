@@ -0,0 +1,176 @@
+// Copyright (C) 2018 Michael J. Fromberger. All Rights Reserved.
+
+package prgfile
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"strings"
+	"testing"
+)
+
+// roundTrip decodes input, re-encodes the result with a Writer, and returns
+// the rendering of decoding that output again.
+func roundTrip(input string) (string, error) {
+	r, err := New(strings.NewReader(input))
+	if err != nil {
+		return "", err
+	}
+	var lines []*Line
+	for {
+		line, err := r.Line()
+		if err == io.EOF {
+			break
+		} else if err != nil {
+			return "", err
+		}
+		lines = append(lines, line)
+	}
+
+	var buf bytes.Buffer
+	w, err := NewWriter(&buf, r.Origin())
+	if err != nil {
+		return "", err
+	}
+	for _, line := range lines {
+		if err := w.Put(line); err != nil {
+			return "", err
+		}
+	}
+	if err := w.Close(); err != nil {
+		return "", err
+	}
+	return run(buf.String())
+}
+
+// runOpts is like run, but decodes with the given dialect and charset.
+func runOpts(input string, d *Dialect, cs Charset) (string, error) {
+	r, err := New(strings.NewReader(input), WithDialect(d), WithCharset(cs))
+	if err != nil {
+		return "", fmt.Errorf("New(%q): %v", input, err)
+	}
+
+	var got strings.Builder
+	fmt.Fprintf(&got, "@%04x\n", r.Origin())
+	for {
+		next, err := r.Line()
+		if err == io.EOF {
+			break
+		} else if err != nil {
+			return "", err
+		}
+		fmt.Fprintf(&got, "%04x %d ", next.Addr, next.N)
+		for i, insn := range next.Insn {
+			if i > 0 {
+				got.WriteByte(':')
+			}
+			got.WriteString(insn)
+		}
+		got.WriteByte('\n')
+	}
+	return got.String(), nil
+}
+
+// roundTripOpts is like roundTrip, but decodes and re-encodes with the
+// given dialect and charset, which must agree between Reader and Writer
+// for the round trip to reproduce the original bytes.
+func roundTripOpts(input string, d *Dialect, cs Charset) (string, error) {
+	r, err := New(strings.NewReader(input), WithDialect(d), WithCharset(cs))
+	if err != nil {
+		return "", err
+	}
+	var lines []*Line
+	for {
+		line, err := r.Line()
+		if err == io.EOF {
+			break
+		} else if err != nil {
+			return "", err
+		}
+		lines = append(lines, line)
+	}
+
+	var buf bytes.Buffer
+	w, err := NewWriter(&buf, r.Origin(), WithWriterDialect(d), WithWriterCharset(cs))
+	if err != nil {
+		return "", err
+	}
+	for _, line := range lines {
+		if err := w.Put(line); err != nil {
+			return "", err
+		}
+	}
+	if err := w.Close(); err != nil {
+		return "", err
+	}
+	return runOpts(buf.String(), d, cs)
+}
+
+func TestWriterRoundTripDialect(t *testing.T) {
+	// "10 DO : PRINT"NG" : LOOP", tokenized against BASIC 3.5 (see
+	// TestReaderDialect): DO and LOOP only exist via the 0xfe escape
+	// prefix, so a Writer that ignores the dialect would re-encode them as
+	// literal ASCII instead of the two-byte token.
+	const input = "\x01\x00\x12\x00\x0a\x00\xfe\x00:\x99\"NG\":\xfe\x01\x00\x00\x00"
+
+	want, err := runOpts(input, DialectBASIC35, CharsetRaw)
+	if err != nil {
+		t.Fatalf("Reading %q: unexpected error: %v", input, err)
+	}
+	got, err := roundTripOpts(input, DialectBASIC35, CharsetRaw)
+	if err != nil {
+		t.Fatalf("Round-tripping %q: unexpected error: %v", input, err)
+	} else if got != want {
+		t.Errorf("Round-tripping %q:\n got: %#q\nwant: %#q", input, got, want)
+	}
+}
+
+func TestWriterRoundTripCharset(t *testing.T) {
+	// 10 PRINT "<reverse-on>HI<reverse-off>": the quoted string decodes to
+	// PUA runes under CharsetPETSCIIUnshifted, which a Writer that copies
+	// Insn text byte-by-byte would mangle into the runes' raw UTF-8 bytes.
+	const input = "\x01\x00\x06\x00\x0a\x00\x99 \"\x12\x48\x49\x92\"\x00\x00\x00"
+
+	want, err := runOpts(input, DialectBASIC2, CharsetPETSCIIUnshifted)
+	if err != nil {
+		t.Fatalf("Reading %q: unexpected error: %v", input, err)
+	}
+	got, err := roundTripOpts(input, DialectBASIC2, CharsetPETSCIIUnshifted)
+	if err != nil {
+		t.Fatalf("Round-tripping %q: unexpected error: %v", input, err)
+	} else if got != want {
+		t.Errorf("Round-tripping %q:\n got: %#q\nwant: %#q", input, got, want)
+	}
+}
+
+func TestWriterRoundTrip(t *testing.T) {
+	tests := []string{
+		// Empty program at origin 0xc030.
+		"\x30\xc0\x00\x00",
+
+		// One line with no instructions at 0x0000.
+		"\x00\x00\x04\x00\x00\x00\x00\x00\x00",
+
+		// One line with a single END instruction.
+		"\x01\x00\x03\x00\x0a\x00\x80\x00\x00\x00",
+
+		// Example based on https://www.c64-wiki.com/wiki/BASIC_token.
+		"\x01\x08\x15\x08\x64\x00\x99 \"HELLO WORLD\"\x00\x1c\x08\x6e\x00\x89100\x00\x00\x00",
+
+		// GOTO entered with an intervening space between GO and TO.
+		"\x01\x00\x04\x00\x0a\x00\xcb TO 10\x00\x00\x00",
+	}
+	for _, test := range tests {
+		want, err := run(test)
+		if err != nil {
+			t.Fatalf("Reading %q: unexpected error: %v", test, err)
+		}
+		got, err := roundTrip(test)
+		if err != nil {
+			t.Errorf("Round-tripping %q: unexpected error: %v", test, err)
+		} else if got != want {
+			t.Errorf("Round-tripping %q:\n got: %#q\nwant: %#q", test, got, want)
+		}
+	}
+}